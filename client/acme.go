@@ -0,0 +1,314 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+This file contains optional ACME integration for obtaining and rotating
+the client's mTLS certificate, for short-lived container environments
+where baking certs into images or pre-provisioning files on disk is
+undesirable.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/imoore76/go-ldlm/clock"
+)
+
+// ACMEConfig configures automatic client certificate acquisition and
+// renewal via ACME, fed into New as an alternative to TlsCert/TlsKey.
+type ACMEConfig struct {
+	DirectoryURL string    // ACME directory URL
+	Email        string    // contact email for the ACME account
+	Host         string    // identifier the issued certificate authenticates as
+	CacheDir     string    // directory backing the default filesystem CertCache
+	Cache        CertCache // overrides the filesystem cache if set
+	// RenewBefore is how long before expiry to renew the certificate,
+	// mirroring autocert's createCertRetryAfter lead time. Defaults to 30
+	// days.
+	RenewBefore time.Duration
+}
+
+// CertCache persists the ACME account key so it survives process
+// restarts. Issued certificates are not cached; a new one is obtained on
+// every start. Implement this to plug in Vault, S3, or an in-memory cache
+// instead of the filesystem.
+type CertCache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// dirCache is the default CertCache, backed by a directory on disk,
+// mirroring autocert.DirCache.
+type dirCache string
+
+func (d dirCache) Get(_ context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), key))
+}
+
+func (d dirCache) Put(_ context.Context, key string, data []byte) error {
+	if err := os.MkdirAll(string(d), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(string(d), key), data, 0600)
+}
+
+func (d dirCache) Delete(_ context.Context, key string) error {
+	return os.Remove(filepath.Join(string(d), key))
+}
+
+const acmeAccountKeyCacheKey = "acme_account_key.pem"
+
+// acmeManager obtains and rotates a client certificate via ACME, feeding
+// the result into tls.Config.GetClientCertificate so renewal is
+// invisible to the gRPC transport. Renewal runs on the same clock as the
+// lock refreshers, so it can be driven deterministically in tests.
+type acmeManager struct {
+	conf  ACMEConfig
+	cache CertCache
+	clock clock.Clock
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newACMEManager validates conf, obtains an initial certificate, and
+// starts the background renewal loop.
+func newACMEManager(ctx context.Context, conf ACMEConfig, clk clock.Clock) (*acmeManager, error) {
+	if conf.DirectoryURL == "" {
+		return nil, fmt.Errorf("ACME.DirectoryURL is required")
+	}
+	if conf.Host == "" {
+		return nil, fmt.Errorf("ACME.Host is required")
+	}
+
+	cache := conf.Cache
+	if cache == nil {
+		if conf.CacheDir == "" {
+			return nil, fmt.Errorf("ACME.CacheDir or ACME.Cache is required")
+		}
+		cache = dirCache(conf.CacheDir)
+	}
+	if conf.RenewBefore <= 0 {
+		conf.RenewBefore = 30 * 24 * time.Hour
+	}
+
+	m := &acmeManager{conf: conf, cache: cache, clock: clk, stop: make(chan struct{})}
+	if err := m.renew(ctx); err != nil {
+		return nil, err
+	}
+	m.startRenewalLoop()
+	return m, nil
+}
+
+// GetClientCertificate satisfies tls.Config.GetClientCertificate.
+func (m *acmeManager) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert, nil
+}
+
+// renew obtains a fresh certificate and swaps it in for
+// GetClientCertificate to hand out.
+func (m *acmeManager) renew(ctx context.Context) error {
+	cert, err := m.obtain(ctx)
+	if err != nil {
+		return fmt.Errorf("error obtaining ACME client certificate: %w", err)
+	}
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+	return nil
+}
+
+// accountKey loads the ACME account key from cache, generating and
+// caching a new one on first use.
+func (m *acmeManager) accountKey(ctx context.Context) (*ecdsa.PrivateKey, error) {
+	if der, err := m.cache.Get(ctx, acmeAccountKeyCacheKey); err == nil {
+		return x509.ParseECPrivateKey(der)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.cache.Put(ctx, acmeAccountKeyCacheKey, der); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// obtain runs the ACME order flow for m.conf.Host: register (or reuse)
+// an account, satisfy an HTTP-01 challenge, finalize the order with a
+// freshly generated key and CSR, and return the resulting certificate.
+func (m *acmeManager) obtain(ctx context.Context) (*tls.Certificate, error) {
+	accountKey, err := m.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ac := &acme.Client{Key: accountKey, DirectoryURL: m.conf.DirectoryURL}
+	account := &acme.Account{}
+	if m.conf.Email != "" {
+		account.Contact = []string{"mailto:" + m.conf.Email}
+	}
+	if _, err := ac.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, fmt.Errorf("registering ACME account: %w", err)
+	}
+
+	order, err := ac.AuthorizeOrder(ctx, []acme.AuthzID{{Type: "dns", Value: m.conf.Host}})
+	if err != nil {
+		return nil, fmt.Errorf("authorizing ACME order: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.satisfyHTTP01(ctx, ac, authzURL); err != nil {
+			return nil, err
+		}
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := certRequest(certKey, m.conf.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	der, _, err := ac.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("finalizing ACME order: %w", err)
+	}
+
+	return &tls.Certificate{Certificate: der, PrivateKey: certKey}, nil
+}
+
+// satisfyHTTP01 completes the HTTP-01 challenge for a single
+// authorization by briefly serving the key authorization on :80.
+func (m *acmeManager) satisfyHTTP01(ctx context.Context, ac *acme.Client, authzURL string) error {
+	authz, err := ac.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no http-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	keyAuth, err := ac.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ac.HTTP01ChallengePath(chal.Token), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, keyAuth)
+	})
+	ln, err := net.Listen("tcp", ":80")
+	if err != nil {
+		return fmt.Errorf("binding :80 for ACME http-01 challenge: %w", err)
+	}
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	if _, err := ac.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("accepting ACME challenge: %w", err)
+	}
+	if _, err := ac.WaitAuthorization(ctx, authzURL); err != nil {
+		return fmt.Errorf("waiting on ACME authorization: %w", err)
+	}
+	return nil
+}
+
+// startRenewalLoop renews the certificate RenewBefore its expiry,
+// mirroring autocert's createCertRetryAfter, using m.clock so tests can
+// drive it deterministically instead of waiting for real time to pass.
+// The loop exits once Close stops m.
+func (m *acmeManager) startRenewalLoop() {
+	go func() {
+		for {
+			wait := m.conf.RenewBefore
+			m.mu.RLock()
+			if m.cert != nil && len(m.cert.Certificate) > 0 {
+				if leaf, err := x509.ParseCertificate(m.cert.Certificate[0]); err == nil {
+					if d := leaf.NotAfter.Sub(m.clock.Now()) - m.conf.RenewBefore; d > 0 {
+						wait = d
+					}
+				}
+			}
+			m.mu.RUnlock()
+
+			t := m.clock.NewTimer(wait)
+			select {
+			case <-m.stop:
+				if !t.Stop() {
+					<-t.C()
+				}
+				return
+			case <-t.C():
+				// Keep using the last known-good certificate on failure;
+				// the next tick will retry.
+				_ = m.renew(context.Background())
+			}
+		}
+	}()
+}
+
+// Close stops the renewal loop. It is safe to call more than once.
+func (m *acmeManager) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// certRequest builds a PKCS#10 CSR for host, signed by key.
+func certRequest(key *ecdsa.PrivateKey, host string) ([]byte, error) {
+	tmpl := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: host},
+		DNSNames: []string{host},
+	}
+	return x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+}
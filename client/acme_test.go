@@ -0,0 +1,116 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/imoore76/go-ldlm/clock/fakeclock"
+)
+
+// signalingCache is a CertCache double that always misses, but signals
+// calls on a channel so a test can observe each renewal attempt without
+// a real ACME server.
+type signalingCache struct {
+	calls chan struct{}
+}
+
+func (c *signalingCache) Get(_ context.Context, _ string) ([]byte, error) {
+	select {
+	case c.calls <- struct{}{}:
+	default:
+	}
+	return nil, os.ErrNotExist
+}
+
+func (c *signalingCache) Put(_ context.Context, _ string, _ []byte) error { return nil }
+func (c *signalingCache) Delete(_ context.Context, _ string) error        { return nil }
+
+// newTestACMEManager builds an acmeManager directly, bypassing
+// newACMEManager's initial synchronous renew (which requires a real ACME
+// server), so the renewal loop can be driven entirely by clk.
+func newTestACMEManager(clk *fakeclock.Clock, cache *signalingCache) *acmeManager {
+	return &acmeManager{
+		conf: ACMEConfig{
+			// Nothing listens here; ac.Register fails immediately with a
+			// connection error instead of hanging or doing a real DNS
+			// lookup, which is all this test needs from it.
+			DirectoryURL: "http://127.0.0.1:1/directory",
+			Host:         "example.com",
+			RenewBefore:  time.Hour,
+		},
+		cache: cache,
+		clock: clk,
+		stop:  make(chan struct{}),
+	}
+}
+
+// TestAcmeManager_RenewalLoopFiresOnFakeClock verifies that
+// startRenewalLoop waits on m.clock rather than real time: with no
+// certificate cached yet, the first renewal attempt is due after
+// RenewBefore, and advancing the fake clock past it triggers one.
+func TestAcmeManager_RenewalLoopFiresOnFakeClock(t *testing.T) {
+	clk := fakeclock.New()
+	cache := &signalingCache{calls: make(chan struct{}, 4)}
+	m := newTestACMEManager(clk, cache)
+	m.startRenewalLoop()
+	defer m.Close()
+
+	select {
+	case <-cache.calls:
+		t.Fatal("renewal attempted before RenewBefore elapsed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clk.Advance(time.Hour)
+
+	select {
+	case <-cache.calls:
+	case <-time.After(time.Second):
+		t.Fatal("renewal loop did not fire after the fake clock advanced past RenewBefore")
+	}
+}
+
+// TestAcmeManager_CloseStopsLoopWithoutWaitingForTimer verifies Close
+// interrupts the loop immediately, before its timer would ever fire, and
+// that Close is idempotent.
+func TestAcmeManager_CloseStopsLoopWithoutWaitingForTimer(t *testing.T) {
+	clk := fakeclock.New()
+	cache := &signalingCache{calls: make(chan struct{}, 4)}
+	m := newTestACMEManager(clk, cache)
+	m.startRenewalLoop()
+
+	done := make(chan struct{})
+	go func() {
+		m.Close()
+		m.Close() // idempotent: must not panic or block
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return promptly")
+	}
+
+	select {
+	case <-cache.calls:
+		t.Fatal("renewal was attempted even though Close fired before RenewBefore elapsed")
+	default:
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+This file contains a minimal health-aware balancer that pins RPCs to a
+single endpoint at a time (to preserve lock/key affinity) and fails over
+to another healthy endpoint when the pinned one stops responding.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/imoore76/go-ldlm/protos"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// How long an endpoint is considered unhealthy before it is eligible to be
+// re-probed.
+var unhealthyCooldown = 10 * time.Second
+
+// endpoint represents a single dialed connection to an LDLM server along
+// with its observed health.
+type endpoint struct {
+	addr string
+	conn Closer
+	pbc  pb.LDLMClient
+
+	mu          sync.Mutex
+	healthy     bool
+	unhealthyAt time.Time
+}
+
+// markUnhealthy marks the endpoint unhealthy as of now.
+func (e *endpoint) markUnhealthy() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.healthy = false
+	e.unhealthyAt = time.Now()
+}
+
+// isAvailable returns true if the endpoint is healthy, or if its cooldown
+// period has elapsed and it is eligible to be re-probed.
+func (e *endpoint) isAvailable() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.healthy || time.Since(e.unhealthyAt) >= unhealthyCooldown
+}
+
+// isHealthy returns the endpoint's current health, guarded by e.mu so it
+// can be read safely while another goroutine calls markUnhealthy or
+// probe concurrently.
+func (e *endpoint) isHealthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.healthy
+}
+
+// probeTimeout bounds how long a single health probe may take. failover
+// calls probe synchronously while holding up every public Lock/TryLock/
+// Unlock/RefreshLock caller, so a hung endpoint must not be able to stall
+// on the caller's own (often unbounded) context.
+var probeTimeout = unhealthyCooldown / 5
+
+// probe issues a lightweight RPC against the endpoint to determine whether
+// it has recovered. Any response - even an application-level error response
+// - proves the endpoint is reachable. Only transport-level errors
+// (Unavailable, DeadlineExceeded) keep it marked unhealthy. The probe is
+// bounded by probeTimeout regardless of ctx's own deadline, so an
+// unresponsive endpoint can't stall the caller indefinitely.
+func (e *endpoint) probe(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	_, err := e.pbc.Unlock(ctx, &pb.UnlockRequest{Name: "", Key: ""})
+	if err != nil && isTransientError(err) {
+		return false
+	}
+	e.mu.Lock()
+	e.healthy = true
+	e.mu.Unlock()
+	return true
+}
+
+// balancer holds the set of dialed endpoints for a client and pins RPCs to
+// a single healthy endpoint, re-pinning on failure. This is similar in
+// spirit to the etcd v3 client's endpoint balancer, but deliberately
+// simple: LDLM locks are bound to whichever server granted them, so there
+// is no need to round-robin or load balance across healthy endpoints.
+type balancer struct {
+	mu        sync.Mutex
+	endpoints []*endpoint
+	pinned    int
+}
+
+// newBalancer dials every address and returns a balancer pinned to the
+// first address.
+//
+// Parameters:
+//   - addresses: The list of host:port addresses to balance across.
+//   - dialer: A function that dials a single address, returning its
+//     connection and LDLM client stub.
+//
+// Returns:
+// - *balancer: The newly created balancer, pinned to its first endpoint.
+// - error: An error if any endpoint could not be dialed.
+func newBalancer(addresses []string, dialer func(addr string) (Closer, pb.LDLMClient, error)) (*balancer, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no addresses configured")
+	}
+
+	endpoints := make([]*endpoint, 0, len(addresses))
+	for _, addr := range addresses {
+		conn, pbc, err := dialer(addr)
+		if err != nil {
+			return nil, fmt.Errorf("error dialing %s: %w", addr, err)
+		}
+		endpoints = append(endpoints, &endpoint{
+			addr:    addr,
+			conn:    conn,
+			pbc:     pbc,
+			healthy: true,
+		})
+	}
+
+	return &balancer{
+		endpoints: endpoints,
+	}, nil
+}
+
+// current returns the currently pinned endpoint.
+func (b *balancer) current() *endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.endpoints[b.pinned]
+}
+
+// size returns the number of endpoints the balancer holds. b.endpoints
+// is fixed for the balancer's lifetime, so this is safe to read without
+// b.mu.
+func (b *balancer) size() int {
+	return len(b.endpoints)
+}
+
+// failover marks the currently pinned endpoint unhealthy and pins the
+// balancer to the next available endpoint, probing unhealthy ones whose
+// cooldown has elapsed along the way.
+//
+// b.endpoints is fixed for the balancer's lifetime, so it's safe to read
+// without b.mu; only b.pinned needs it, and it's held just long enough to
+// read or update that field - never across a probe, which issues a
+// network RPC and would otherwise block every current() caller on it.
+//
+// Parameters:
+// - ctx: The context.Context used to probe candidate endpoints.
+// - failed: The endpoint that just failed an RPC.
+//
+// Returns:
+// - *endpoint: The newly pinned endpoint.
+// - error: An error if no endpoint is reachable.
+func (b *balancer) failover(ctx context.Context, failed *endpoint) (*endpoint, error) {
+	failed.markUnhealthy()
+
+	start := b.pinnedIndex()
+	n := len(b.endpoints)
+	for i := 1; i <= n; i++ {
+		idx := (start + i) % n
+		ep := b.endpoints[idx]
+		if ep == failed && !ep.isAvailable() {
+			continue
+		}
+		if !ep.isHealthy() {
+			if !ep.isAvailable() || !ep.probe(ctx) {
+				continue
+			}
+		}
+		b.mu.Lock()
+		b.pinned = idx
+		b.mu.Unlock()
+		return ep, nil
+	}
+
+	return nil, fmt.Errorf("no healthy ldlm endpoint available")
+}
+
+// pinnedIndex returns the index of the currently pinned endpoint.
+func (b *balancer) pinnedIndex() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pinned
+}
+
+// Close closes every endpoint's connection.
+func (b *balancer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var firstErr error
+	for _, ep := range b.endpoints {
+		if err := ep.conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// isTransientError returns true if err indicates the endpoint that
+// produced it should be considered unhealthy - i.e. the server is
+// unavailable or didn't respond in time, as opposed to an application
+// level error returned by a healthy server.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return true
+	}
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/imoore76/go-ldlm/protos"
+	"google.golang.org/grpc"
+)
+
+// newTestBalancer returns a balancer of n endpoints, all healthy, without
+// dialing anything - suitable for exercising failover/pinning logic
+// directly.
+func newTestBalancer(n int) *balancer {
+	eps := make([]*endpoint, n)
+	for i := range eps {
+		eps[i] = &endpoint{addr: fmt.Sprintf("ep%d", i), healthy: true}
+	}
+	return &balancer{endpoints: eps}
+}
+
+func TestBalancer_Failover(t *testing.T) {
+	b := newTestBalancer(3)
+	failed := b.current()
+
+	next, err := b.failover(context.Background(), failed)
+	if err != nil {
+		t.Fatalf("failover: %v", err)
+	}
+	if next == failed {
+		t.Fatal("failover re-pinned to the endpoint that just failed")
+	}
+	if b.current() != next {
+		t.Fatal("balancer did not re-pin to the endpoint failover returned")
+	}
+	if failed.isHealthy() {
+		t.Fatal("failed endpoint was not marked unhealthy")
+	}
+}
+
+func TestBalancer_FailoverNoneAvailable(t *testing.T) {
+	b := newTestBalancer(2)
+	for _, ep := range b.endpoints {
+		ep.healthy = false
+		ep.unhealthyAt = time.Now()
+	}
+
+	if _, err := b.failover(context.Background(), b.endpoints[0]); err == nil {
+		t.Fatal("expected an error when no endpoint is available")
+	}
+}
+
+// blockingLDLMClient is a pb.LDLMClient double whose Unlock blocks until
+// the RPC's context is done, for exercising probe's own timeout.
+type blockingLDLMClient struct {
+	fakeLDLMClient
+}
+
+func (c *blockingLDLMClient) Unlock(ctx context.Context, in *pb.UnlockRequest, opts ...grpc.CallOption) (*pb.UnlockResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// TestEndpoint_ProbeTimesOutIndependentlyOfCallerContext verifies that
+// probe bounds itself with its own timeout instead of hanging for as long
+// as the caller's context allows - failover calls probe synchronously, so
+// an unbounded caller context (e.g. context.Background()) must not let a
+// hung endpoint stall every in-flight public call.
+func TestEndpoint_ProbeTimesOutIndependentlyOfCallerContext(t *testing.T) {
+	orig := probeTimeout
+	probeTimeout = 10 * time.Millisecond
+	defer func() { probeTimeout = orig }()
+
+	ep := &endpoint{addr: "slow", pbc: &blockingLDLMClient{}}
+
+	done := make(chan bool, 1)
+	go func() { done <- ep.probe(context.Background()) }()
+
+	select {
+	case healthy := <-done:
+		if healthy {
+			t.Fatal("probe reported healthy despite its RPC never returning a response")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("probe did not honor probeTimeout; it blocked on the caller's unbounded context")
+	}
+}
+
+// TestEndpoint_HealthyRace exercises isHealthy and markUnhealthy
+// concurrently under the race detector, guarding against the reads and
+// writes of endpoint.healthy going through different mutexes.
+func TestEndpoint_HealthyRace(t *testing.T) {
+	ep := &endpoint{healthy: true}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			ep.markUnhealthy()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = ep.isHealthy()
+		}()
+	}
+	wg.Wait()
+}
@@ -24,20 +24,19 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/imoore76/go-ldlm/clock"
 	"github.com/imoore76/go-ldlm/lock"
 	pb "github.com/imoore76/go-ldlm/protos"
 	"github.com/imoore76/go-ldlm/server"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 // Re-namespace errors here so they can be easily used by clients
@@ -59,15 +58,57 @@ var (
 )
 
 type Config struct {
-	Address       string // host:port address of ldlm server
-	NoAutoRefresh bool   // Don't automatically refresh locks before they expire
-	UseTls        bool   // use TLS to connect to the server
-	SkipVerify    bool   // don't verify the server's certificate
-	CAFile        string // file containing a CA certificate
-	TlsCert       string // file containing a TLS certificate for this client
-	TlsKey        string // file containing a TLS key for this client
-	Password      string // password to send
-	MaxRetries    int    // maximum number of retries on network error or server unreachable
+	Address       string   // host:port address of ldlm server, or a comma-separated list of addresses
+	Addresses     []string // host:port addresses of ldlm servers. Merged with Address if both are set
+	NoAutoRefresh bool     // Don't automatically refresh locks before they expire
+	UseTls        bool     // use TLS to connect to the server
+	SkipVerify    bool     // don't verify the server's certificate
+	CAFile        string   // file containing a CA certificate
+	TlsCert       string   // file containing a TLS certificate for this client
+	TlsKey        string   // file containing a TLS key for this client
+	// ACME, if set, obtains and rotates the client's TLS certificate
+	// automatically instead of reading TlsCert/TlsKey from disk.
+	ACME       *ACMEConfig
+	Password   string      // password to send
+	MaxRetries int         // maximum number of retries on network error or server unreachable
+	Transport  string      // wire transport to use: "grpc" (default) or "http"
+	Clock      clock.Clock // time source for the refresher; defaults to the real clock
+	// OnRefreshError, if set, is called every time a lock's auto-refresh RPC
+	// fails, whether or not the refresher will retry.
+	OnRefreshError func(name string, err error, willRetry bool)
+	// OnLockLost, if set, is called when a lock's auto-refresher gives up
+	// for good because the lock no longer exists or the key is invalid.
+	OnLockLost func(name string)
+	// ReleaseOnSignal installs a SIGINT/SIGTERM handler (see Guard) that
+	// releases every auto-refreshed lock before the process exits.
+	ReleaseOnSignal bool
+	// ShutdownTimeout bounds how long Guard and Close wait for in-flight
+	// Unlock calls when releasing locks. Defaults to 10 seconds.
+	ShutdownTimeout time.Duration
+}
+
+// addresses returns the de-duplicated, de-comma-separated list of server
+// addresses configured in conf.
+func (conf Config) addresses() []string {
+	seen := make(map[string]bool)
+	addrs := make([]string, 0, len(conf.Addresses)+1)
+
+	add := func(a string) {
+		a = strings.TrimSpace(a)
+		if a == "" || seen[a] {
+			return
+		}
+		seen[a] = true
+		addrs = append(addrs, a)
+	}
+
+	for _, a := range strings.Split(conf.Address, ",") {
+		add(a)
+	}
+	for _, a := range conf.Addresses {
+		add(a)
+	}
+	return addrs
 }
 
 // Simple lock struct returned to clients.
@@ -76,6 +117,17 @@ type Lock struct {
 	Name   string
 	Key    string
 	Locked bool
+	valid  *atomic.Bool
+}
+
+// Valid reports whether this lock is still believed to be held. It
+// starts out matching Locked, and flips to false if the auto-refresher
+// gives up on keeping the lock alive (see Config.OnLockLost).
+func (l *Lock) Valid() bool {
+	if l.valid == nil {
+		return l.Locked
+	}
+	return l.valid.Load()
 }
 
 // Lock options struct.
@@ -83,6 +135,25 @@ type LockOptions struct {
 	WaitTimeoutSeconds int32
 	LockTimeoutSeconds int32
 	Size               int32
+	// RefreshPolicy overrides how the auto-refresher paces itself for this
+	// lock. If nil, the refresher falls back to the lockTimeoutSeconds-30
+	// heuristic.
+	RefreshPolicy *RefreshPolicy
+}
+
+// RefreshPolicy controls when the auto-refresher fires relative to a
+// lock's timeout.
+type RefreshPolicy struct {
+	// LeadSeconds is how long before the lock's timeout to refresh it.
+	// Defaults to 30.
+	LeadSeconds int32
+	// MinIntervalSeconds floors the computed refresh interval, so a short
+	// lock timeout doesn't result in refreshing too frequently. Defaults
+	// to minRefreshSeconds (10).
+	MinIntervalSeconds int32
+	// Jitter randomizes the refresh interval by up to +/- this fraction
+	// of itself (0 to 1) to avoid many refreshers firing in lockstep.
+	Jitter float64
 }
 
 // Unlock attempts to release the lock.
@@ -108,12 +179,18 @@ type Closer interface {
 }
 
 type client struct {
-	conn          Closer
-	pbc           pb.LDLMClient
-	ctx           context.Context
-	refreshMap    sync.Map
-	noAutoRefresh bool
-	maxRetries    int
+	transport       transport
+	ctx             context.Context
+	refreshMap      sync.Map
+	noAutoRefresh   bool
+	clock           clock.Clock
+	onRefreshError  func(name string, err error, willRetry bool)
+	onLockLost      func(name string)
+	shutdownTimeout time.Duration
+	closeOnce       sync.Once
+	closeErr        error
+	deregisterGuard func()
+	acme            *acmeManager
 }
 
 // New creates a new client instance with the given configuration.
@@ -127,13 +204,31 @@ type client struct {
 // - *client: The newly created client instance.
 // - error: An error if the client creation fails.
 func New(ctx context.Context, conf Config, opts ...grpc.DialOption) (*client, error) {
-	creds := insecure.NewCredentials()
-	if conf.UseTls || conf.TlsCert != "" {
-		tlsC := &tls.Config{
-			ServerName:         strings.Split(conf.Address, ":")[0],
+	addresses := conf.addresses()
+	if len(addresses) == 0 {
+		return nil, errors.New("no server address configured")
+	}
+
+	clk := conf.Clock
+	if clk == nil {
+		clk = clock.New()
+	}
+
+	var tlsC *tls.Config
+	var acmeM *acmeManager
+	if conf.UseTls || conf.TlsCert != "" || conf.ACME != nil {
+		tlsC = &tls.Config{
+			ServerName:         strings.Split(addresses[0], ":")[0],
 			InsecureSkipVerify: conf.SkipVerify,
 		}
-		if conf.TlsCert != "" {
+		if conf.ACME != nil {
+			am, err := newACMEManager(ctx, *conf.ACME, clk)
+			if err != nil {
+				return nil, fmt.Errorf("error setting up ACME: %w", err)
+			}
+			tlsC.GetClientCertificate = am.GetClientCertificate
+			acmeM = am
+		} else if conf.TlsCert != "" {
 			clientCert, err := tls.LoadX509KeyPair(conf.TlsCert, conf.TlsKey)
 			if err != nil {
 				return nil, fmt.Errorf("error loading TlsCert and TlsKey: %w", err)
@@ -151,30 +246,43 @@ func New(ctx context.Context, conf Config, opts ...grpc.DialOption) (*client, er
 				tlsC.RootCAs = certPool
 			}
 		}
-		creds = credentials.NewTLS(tlsC)
 	}
 
-	opts = append(opts, grpc.WithTransportCredentials(creds))
-	conn, err := grpc.NewClient(
-		conf.Address,
-		opts...,
-	)
+	// Per-host transport credentials (and the insecure fallback) are built
+	// per-address inside newGrpcTransport, so each endpoint's TLS
+	// handshake uses its own ServerName instead of all of them sharing
+	// addresses[0]'s.
+	tr, err := newTransport(conf, addresses, opts, tlsC)
 	if err != nil {
 		return nil, err
 	}
 
-	if conf.Password != "" {
+	if conf.Password != "" && (conf.Transport == "" || conf.Transport == "grpc") {
 		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", conf.Password)
 	}
 
-	return &client{
-		conn:          conn,
-		pbc:           pb.NewLDLMClient(conn),
-		ctx:           ctx,
-		refreshMap:    sync.Map{},
-		noAutoRefresh: conf.NoAutoRefresh,
-		maxRetries:    conf.MaxRetries,
-	}, nil
+	shutdownTimeout := conf.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+
+	c := &client{
+		transport:       tr,
+		ctx:             ctx,
+		refreshMap:      sync.Map{},
+		noAutoRefresh:   conf.NoAutoRefresh,
+		clock:           clk,
+		onRefreshError:  conf.OnRefreshError,
+		onLockLost:      conf.OnLockLost,
+		shutdownTimeout: shutdownTimeout,
+		acme:            acmeM,
+	}
+
+	if conf.ReleaseOnSignal {
+		c.deregisterGuard = c.Guard()
+	}
+
+	return c, nil
 }
 
 // Lock attempts to acquire a lock with the given name and timeouts.
@@ -203,24 +311,22 @@ func (c *client) Lock(name string, o *LockOptions) (*Lock, error) {
 	if o.Size > 0 {
 		req.Size = &o.Size
 	}
-	resp, err := rpcWithRetry(
-		c.maxRetries,
-		func() (*pb.LockResponse, error) {
-			return c.pbc.Lock(c.ctx, req)
-		},
-	)
+	resp, err := c.transport.Lock(c.ctx, req)
 	if err != nil {
 		return nil, err
 	}
 
+	valid := &atomic.Bool{}
+	valid.Store(resp.Locked)
 	if resp.Locked {
-		c.maybeCreateRefresher(resp, o.LockTimeoutSeconds)
+		c.maybeCreateRefresher(resp, o.LockTimeoutSeconds, o.RefreshPolicy, valid)
 	}
 	return &Lock{
 		Name:   resp.Name,
 		Key:    resp.Key,
 		Locked: resp.Locked,
 		client: c,
+		valid:  valid,
 	}, rpcErrorToError(resp.Error)
 
 }
@@ -251,20 +357,21 @@ func (c *client) TryLock(name string, o *LockOptions) (*Lock, error) {
 	if o.Size > 0 {
 		req.Size = &o.Size
 	}
-	resp, err := rpcWithRetry(c.maxRetries, func() (*pb.LockResponse, error) {
-		return c.pbc.TryLock(c.ctx, req)
-	})
+	resp, err := c.transport.TryLock(c.ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	valid := &atomic.Bool{}
+	valid.Store(resp.Locked)
 	if resp.Locked {
-		c.maybeCreateRefresher(resp, o.LockTimeoutSeconds)
+		c.maybeCreateRefresher(resp, o.LockTimeoutSeconds, o.RefreshPolicy, valid)
 	}
 	return &Lock{
 		Name:   resp.Name,
 		Key:    resp.Key,
 		Locked: resp.Locked,
 		client: c,
+		valid:  valid,
 	}, rpcErrorToError(resp.Error)
 }
 
@@ -279,15 +386,10 @@ func (c *client) TryLock(name string, o *LockOptions) (*Lock, error) {
 // - error: An error if the lock release fails.
 func (c *client) Unlock(name string, key string) (bool, error) {
 	c.maybeRemoveRefresher(name)
-	r, err := rpcWithRetry(
-		c.maxRetries,
-		func() (*pb.UnlockResponse, error) {
-			return c.pbc.Unlock(c.ctx, &pb.UnlockRequest{
-				Name: name,
-				Key:  key,
-			})
-		},
-	)
+	r, err := c.transport.Unlock(c.ctx, &pb.UnlockRequest{
+		Name: name,
+		Key:  key,
+	})
 	if err != nil {
 		return false, err
 	}
@@ -305,32 +407,34 @@ func (c *client) Unlock(name string, key string) (bool, error) {
 // - *Lock: A pointer to a Lock struct containing the name, key, and locked status of the lock.
 // - error: An error if the lock refresh fails.
 func (c *client) RefreshLock(name string, key string, lockTimeoutSeconds int32) (*Lock, error) {
-	r, err := rpcWithRetry(
-		c.maxRetries,
-		func() (*pb.LockResponse, error) {
-			return c.pbc.RefreshLock(c.ctx, &pb.RefreshLockRequest{
-				Name: name, Key: key, LockTimeoutSeconds: lockTimeoutSeconds,
-			})
-		},
-	)
+	r, err := c.transport.RefreshLock(c.ctx, &pb.RefreshLockRequest{
+		Name: name, Key: key, LockTimeoutSeconds: lockTimeoutSeconds,
+	})
 	if err != nil {
 		return nil, err
 	}
 	return &Lock{Name: name, Key: r.Key, Locked: r.Locked, client: c}, rpcErrorToError(r.Error)
 }
 
-// Close closes the client connection.
+// Close stops every active refresher, releases the lock each one keeps
+// alive, and closes the client connection. Locks held without a refresher
+// (NoAutoRefresh, or no lock timeout) are not released. It is safe to call
+// more than once; only the first call does any work.
 //
 // No parameters.
 // Returns an error if the connection close fails.
 func (c *client) Close() error {
-	c.refreshMap.Range(func(k, v interface{}) bool {
-		refresher := v.(*refresher)
-		refresher.Stop()
-		return true
+	c.closeOnce.Do(func() {
+		if c.deregisterGuard != nil {
+			c.deregisterGuard()
+		}
+		if c.acme != nil {
+			c.acme.Close()
+		}
+		c.releaseAll(c.shutdownTimeout)
+		c.closeErr = c.transport.Close()
 	})
-
-	return c.conn.Close()
+	return c.closeErr
 }
 
 // maybeCreateRefresher creates a refresher if the lock is locked, auto-refresh is enabled, and the
@@ -339,13 +443,19 @@ func (c *client) Close() error {
 // Parameters:
 // - r: A pointer to a LockResponse struct containing the lock information.
 // - lockTimeoutSeconds: A int32 representing the lock timeout in seconds.
-func (c *client) maybeCreateRefresher(r *pb.LockResponse, lockTimeoutSeconds int32) {
+// - policy: An optional RefreshPolicy overriding the default refresh pacing. May be nil.
+// - valid: The atomic flag backing the returned Lock's Valid() method. The refresher flips
+//   it to false if it gives up trying to keep the lock alive.
+func (c *client) maybeCreateRefresher(r *pb.LockResponse, lockTimeoutSeconds int32, policy *RefreshPolicy, valid *atomic.Bool) {
 	if !r.Locked || c.noAutoRefresh || lockTimeoutSeconds == 0 {
 		return
 	}
+	if policy == nil {
+		policy = &RefreshPolicy{}
+	}
 
 	// Create and add lock to refresh map
-	rFresher := NewRefresher(c, r.Name, r.Key, lockTimeoutSeconds)
+	rFresher := NewRefresher(c, r.Name, r.Key, lockTimeoutSeconds, *policy, valid)
 	if _, loaded := c.refreshMap.LoadOrStore(r.Name, rFresher); loaded {
 		panic("client out of sync - lock already exists in refresh map")
 	}
@@ -376,78 +486,169 @@ type refresher struct {
 	name               string
 	key                string
 	lockTimeoutSeconds int32
+	policy             RefreshPolicy
+	valid              *atomic.Bool
 	stop               chan struct{}
+	stopOnce           sync.Once
+	backoffAttempt     int
 }
 
-// NewRefresher creates a new refresher instance with the given client, name, key, and lock timeout.
+// NewRefresher creates a new refresher instance with the given client, name, key, lock timeout,
+// and refresh policy.
 //
 // Parameters:
 // - client: A pointer to a client struct.
 // - name: A string representing the name of the refresher.
 // - key: A string representing the key of the refresher.
 // - lockTimeoutSeconds: An unsigned 32-bit integer representing the lock timeout in seconds.
+// - policy: The RefreshPolicy controlling when the refresher fires.
+// - valid: The atomic flag flipped to false if the refresher gives up on the lock.
 //
 // Return:
 // - A pointer to a refresher struct.
-func NewRefresher(client *client, name string, key string, lockTimeoutSeconds int32) *refresher {
+func NewRefresher(client *client, name string, key string, lockTimeoutSeconds int32, policy RefreshPolicy, valid *atomic.Bool) *refresher {
 	r := &refresher{
 		client:             client,
 		name:               name,
 		key:                key,
 		lockTimeoutSeconds: lockTimeoutSeconds,
+		policy:             policy,
+		valid:              valid,
 		stop:               make(chan struct{}),
 	}
 	r.Start()
 	return r
 }
 
+// interval computes how long the refresher should wait before its next
+// refresh attempt, applying r.policy's overrides (and their defaults) on
+// top of r.lockTimeoutSeconds, then adding jitter if configured.
+func (r *refresher) interval() time.Duration {
+	lead := r.policy.LeadSeconds
+	if lead <= 0 {
+		lead = 30
+	}
+	minInterval := r.policy.MinIntervalSeconds
+	if minInterval <= 0 {
+		minInterval = minRefreshSeconds
+	}
+
+	var seconds int32
+	if r.lockTimeoutSeconds <= lead {
+		seconds = minInterval
+	} else {
+		// an unsigned int that is less than lead would wrap here
+		seconds = max(r.lockTimeoutSeconds-lead, minInterval)
+	}
+
+	d := time.Duration(seconds) * time.Second
+	if r.policy.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * r.policy.Jitter * float64(d))
+	}
+	return d
+}
+
+// Base delay for the first backoff attempt after a transient refresh error.
+const refreshBackoffBase = 500 * time.Millisecond
+
+// backoffDelay computes the delay before retrying after a transient error,
+// as min(refreshBackoffBase * 2^backoffAttempt, cap) +/- 20% jitter. cap is
+// half the lock's timeout, so a retry still has a chance to land before the
+// lock expires on the server.
+func (r *refresher) backoffDelay() time.Duration {
+	maxDelay := time.Duration(r.lockTimeoutSeconds) * time.Second / 2
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+
+	d := refreshBackoffBase * time.Duration(1<<min(r.backoffAttempt, 10))
+	if d <= 0 || d > maxDelay {
+		d = maxDelay
+	}
+
+	d += time.Duration((rand.Float64()*2 - 1) * 0.2 * float64(d))
+	return max(d, 0)
+}
+
+// nextDelay returns the delay before the refresher's next attempt: the
+// configured refresh interval if the last attempt succeeded, or a backoff
+// delay if it's retrying after a transient error.
+func (r *refresher) nextDelay() time.Duration {
+	if r.backoffAttempt == 0 {
+		return r.interval()
+	}
+	return r.backoffDelay()
+}
+
+// isTerminalRefreshError reports whether err means the lock itself is gone
+// (rather than the server being transiently unreachable), so the refresher
+// should stop instead of retrying.
+func isTerminalRefreshError(err error) bool {
+	return errors.Is(err, ErrLockDoesNotExist) ||
+		errors.Is(err, ErrInvalidLockKey) ||
+		errors.Is(err, ErrLockDoesNotExistOrInvalidKey)
+}
+
 // Start starts the refresher.
 //
 // It does not take any parameters.
 // It does not return anything.
 func (r *refresher) Start() {
-	var interval int32
-	if r.lockTimeoutSeconds <= 30 {
-		interval = minRefreshSeconds
-	} else {
-		// an unsigned int that is less than 30 would wrap here
-		interval = max(r.lockTimeoutSeconds-30, minRefreshSeconds)
-	}
+	clk := r.client.clock
 	go func() {
 		for {
-			t := time.NewTimer(time.Duration(interval) * time.Second)
+			t := clk.NewTimer(r.nextDelay())
 			select {
 			case <-r.client.ctx.Done():
 				if !t.Stop() {
-					<-t.C
+					<-t.C()
 				}
-				close(r.stop)
 				return
 			case <-r.stop:
 				if !t.Stop() {
-					<-t.C
+					<-t.C()
 				}
-				close(r.stop)
 				return
-			case <-t.C:
-				if _, err := r.client.RefreshLock(r.name, r.key, r.lockTimeoutSeconds); err != nil {
-					panic("error refreshing lock " + r.name + " " + err.Error())
+			case <-t.C():
+				_, err := r.client.RefreshLock(r.name, r.key, r.lockTimeoutSeconds)
+				if err == nil {
+					r.backoffAttempt = 0
+					continue
 				}
+
+				terminal := isTerminalRefreshError(err)
+				if onErr := r.client.onRefreshError; onErr != nil {
+					onErr(r.name, err, !terminal)
+				}
+				if terminal {
+					r.giveUp()
+					return
+				}
+				r.backoffAttempt++
 			}
 		}
 	}()
 }
 
-// Stop stops the refresher by closing the stop channel.
+// giveUp marks the lock invalid, removes its refresher from the client's
+// refresh map, and notifies Config.OnLockLost, because the refresher has
+// determined the lock is no longer held and retrying would be pointless.
+func (r *refresher) giveUp() {
+	if r.valid != nil {
+		r.valid.Store(false)
+	}
+	r.client.refreshMap.Delete(r.name)
+	if r.client.onLockLost != nil {
+		r.client.onLockLost(r.name)
+	}
+}
+
+// Stop stops the refresher. It is safe to call more than once.
 //
 // No parameters.
 // No return values.
 func (r *refresher) Stop() {
-	select {
-	case r.stop <- struct{}{}:
-		<-r.stop
-	default:
-	}
+	r.stopOnce.Do(func() { close(r.stop) })
 }
 
 // rpcErrorToError converts an RPC error to a standard error.
@@ -483,33 +684,3 @@ func rpcErrorToError(err *pb.Error) error {
 
 	return fmt.Errorf("unknown RPC error. code: %d message: %s", err.Code, err.Message)
 }
-
-// rpcWithRetry performs an RPC call with retry logic.
-//
-// It takes two parameters:
-// - maxRetries: an integer representing the maximum number of retries.
-// - f: a function that performs the RPC call and returns a value of type T and an error.
-//
-// The function returns a value of type T and an error.
-func rpcWithRetry[T any](maxRetries int, f func() (T, error)) (T, error) {
-
-	var retries int = 0
-	for {
-		r, err := f()
-		if err != nil {
-			if st, ok := status.FromError(err); ok && st.Code() == codes.Unavailable {
-				if retries >= maxRetries {
-					return r, err
-				}
-				retries++
-				time.Sleep(time.Duration(retryDelaySeconds) * time.Second)
-				continue
-			} else {
-				return r, err
-			}
-
-		} else {
-			return r, nil
-		}
-	}
-}
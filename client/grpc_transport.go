@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+This file contains the default gRPC transport, which balances RPCs across
+the configured endpoints via the health-aware balancer.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"time"
+
+	pb "github.com/imoore76/go-ldlm/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// grpcTransport is the default transport, speaking gRPC to a balancer's
+// worth of endpoints.
+type grpcTransport struct {
+	bal        *balancer
+	maxRetries int
+}
+
+// newGrpcTransport dials every address and returns a grpcTransport pinned
+// to the first one; it fails if any address cannot be dialed. Each address gets its own transport
+// credentials - a clone of tlsC with ServerName set to that address's
+// host, mirroring http_transport.go's per-host TLS config - so a
+// non-first endpoint doesn't hand its server a ServerName it doesn't
+// own. tlsC may be nil, in which case every endpoint dials insecurely.
+func newGrpcTransport(addresses []string, dialOpts []grpc.DialOption, maxRetries int, tlsC *tls.Config) (*grpcTransport, error) {
+	bal, err := newBalancer(addresses, func(addr string) (Closer, pb.LDLMClient, error) {
+		creds := insecure.NewCredentials()
+		if hostTlsC := perHostTLSConfig(tlsC, addr); hostTlsC != nil {
+			creds = credentials.NewTLS(hostTlsC)
+		}
+		addrDialOpts := append(append([]grpc.DialOption{}, dialOpts...), grpc.WithTransportCredentials(creds))
+
+		conn, err := grpc.NewClient(addr, addrDialOpts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, pb.NewLDLMClient(conn), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &grpcTransport{bal: bal, maxRetries: maxRetries}, nil
+}
+
+// perHostTLSConfig returns a clone of tlsC with ServerName set to addr's
+// host, or nil if tlsC is nil. Each endpoint needs its own *tls.Config so
+// its handshake presents/verifies the ServerName it was actually dialed
+// at, instead of every endpoint sharing addresses[0]'s.
+func perHostTLSConfig(tlsC *tls.Config, addr string) *tls.Config {
+	if tlsC == nil {
+		return nil
+	}
+	hostTlsC := tlsC.Clone()
+	hostTlsC.ServerName = strings.Split(addr, ":")[0]
+	return hostTlsC
+}
+
+func (t *grpcTransport) Lock(ctx context.Context, req *pb.LockRequest) (*pb.LockResponse, error) {
+	return rpcWithRetry(ctx, t, func(pbc pb.LDLMClient) (*pb.LockResponse, error) {
+		return pbc.Lock(ctx, req)
+	})
+}
+
+func (t *grpcTransport) TryLock(ctx context.Context, req *pb.TryLockRequest) (*pb.LockResponse, error) {
+	return rpcWithRetry(ctx, t, func(pbc pb.LDLMClient) (*pb.LockResponse, error) {
+		return pbc.TryLock(ctx, req)
+	})
+}
+
+func (t *grpcTransport) Unlock(ctx context.Context, req *pb.UnlockRequest) (*pb.UnlockResponse, error) {
+	return rpcWithRetry(ctx, t, func(pbc pb.LDLMClient) (*pb.UnlockResponse, error) {
+		return pbc.Unlock(ctx, req)
+	})
+}
+
+func (t *grpcTransport) RefreshLock(ctx context.Context, req *pb.RefreshLockRequest) (*pb.LockResponse, error) {
+	return rpcWithRetry(ctx, t, func(pbc pb.LDLMClient) (*pb.LockResponse, error) {
+		return pbc.RefreshLock(ctx, req)
+	})
+}
+
+func (t *grpcTransport) Close() error {
+	return t.bal.Close()
+}
+
+// rpcWithRetry performs an RPC call against t's currently pinned endpoint,
+// retrying on transient errors. On a transient error it asks the balancer
+// to fail over to another healthy endpoint and retries there immediately -
+// this is not gated by t.maxRetries, since otherwise a MaxRetries of 0
+// (the default) would mean a dead pinned endpoint is never failed away
+// from. Failover is attempted at most once per endpoint the balancer
+// holds, to bound retries when every endpoint is down; once a full round
+// of failover attempts is exhausted it falls back to sleeping and
+// retrying the same endpoint, bounded by t.maxRetries, as before.
+//
+// Parameters:
+//   - ctx: The context.Context used when failing over to another endpoint.
+//   - t: The grpcTransport whose balancer holds the candidate endpoints.
+//   - f: a function that performs the RPC call against a given pb.LDLMClient
+//     stub and returns a value of type T and an error.
+//
+// The function returns a value of type T and an error.
+func rpcWithRetry[T any](ctx context.Context, t *grpcTransport, f func(pb.LDLMClient) (T, error)) (T, error) {
+
+	ep := t.bal.current()
+	var retries int = 0
+	var failoverAttempts int = 0
+	maxFailoverAttempts := t.bal.size()
+	for {
+		r, err := f(ep.pbc)
+		if err != nil && isTransientError(err) {
+			if failoverAttempts < maxFailoverAttempts {
+				if newEp, ferr := t.bal.failover(ctx, ep); ferr == nil {
+					failoverAttempts++
+					ep = newEp
+					continue
+				}
+			}
+			if retries >= t.maxRetries {
+				return r, err
+			}
+			retries++
+			time.Sleep(time.Duration(retryDelaySeconds) * time.Second)
+			continue
+		}
+		return r, err
+	}
+}
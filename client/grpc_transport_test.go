@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	pb "github.com/imoore76/go-ldlm/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeLDLMClient is a pb.LDLMClient double whose RPCs all fail with a
+// transient error until failed is flipped to false, letting a test make
+// one endpoint look dead without dialing anything.
+type fakeLDLMClient struct {
+	failed bool
+	calls  int
+}
+
+func (c *fakeLDLMClient) err() error {
+	c.calls++
+	if c.failed {
+		return status.Error(codes.Unavailable, "endpoint down")
+	}
+	return nil
+}
+
+func (c *fakeLDLMClient) Lock(ctx context.Context, in *pb.LockRequest, opts ...grpc.CallOption) (*pb.LockResponse, error) {
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return &pb.LockResponse{Name: in.Name, Locked: true}, nil
+}
+
+func (c *fakeLDLMClient) TryLock(ctx context.Context, in *pb.TryLockRequest, opts ...grpc.CallOption) (*pb.LockResponse, error) {
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return &pb.LockResponse{Name: in.Name, Locked: true}, nil
+}
+
+func (c *fakeLDLMClient) Unlock(ctx context.Context, in *pb.UnlockRequest, opts ...grpc.CallOption) (*pb.UnlockResponse, error) {
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return &pb.UnlockResponse{Unlocked: true}, nil
+}
+
+func (c *fakeLDLMClient) RefreshLock(ctx context.Context, in *pb.RefreshLockRequest, opts ...grpc.CallOption) (*pb.LockResponse, error) {
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return &pb.LockResponse{Name: in.Name, Key: in.Key, Locked: true}, nil
+}
+
+// TestRpcWithRetry_FailsOverWithZeroMaxRetries is the end-to-end
+// regression test for the bug fixed alongside it: with the default
+// MaxRetries of 0, a transient error on the pinned endpoint must still
+// fail over to a healthy endpoint instead of being returned immediately.
+func TestRpcWithRetry_FailsOverWithZeroMaxRetries(t *testing.T) {
+	dead := &fakeLDLMClient{failed: true}
+	alive := &fakeLDLMClient{}
+	bal := &balancer{
+		endpoints: []*endpoint{
+			{addr: "dead", pbc: dead, healthy: true},
+			{addr: "alive", pbc: alive, healthy: true},
+		},
+	}
+	tr := &grpcTransport{bal: bal, maxRetries: 0}
+
+	resp, err := tr.Lock(context.Background(), &pb.LockRequest{Name: "foo"})
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if !resp.Locked {
+		t.Fatal("Lock did not report the lock as acquired")
+	}
+	if alive.calls == 0 {
+		t.Fatal("the healthy endpoint was never tried - rpcWithRetry did not fail over")
+	}
+	if bal.current().pbc != alive {
+		t.Fatal("balancer did not re-pin to the healthy endpoint")
+	}
+}
+
+// TestRpcWithRetry_GivesUpWhenAllEndpointsDown verifies that once a full
+// round of failover attempts is exhausted, rpcWithRetry still honors
+// MaxRetries instead of looping on failover forever.
+func TestRpcWithRetry_GivesUpWhenAllEndpointsDown(t *testing.T) {
+	a := &fakeLDLMClient{failed: true}
+	b := &fakeLDLMClient{failed: true}
+	bal := &balancer{
+		endpoints: []*endpoint{
+			{addr: "a", pbc: a, healthy: true},
+			{addr: "b", pbc: b, healthy: true},
+		},
+	}
+	tr := &grpcTransport{bal: bal, maxRetries: 0}
+
+	orig := retryDelaySeconds
+	retryDelaySeconds = 0 // don't actually sleep in the test
+	defer func() { retryDelaySeconds = orig }()
+
+	_, err := tr.Lock(context.Background(), &pb.LockRequest{Name: "foo"})
+	if err == nil {
+		t.Fatal("expected an error when every endpoint is down")
+	}
+}
+
+// TestPerHostTLSConfig_PerHostServerName mirrors
+// TestNewHttpTransport_PerHostServerName: every address newGrpcTransport
+// dials must get its own ServerName instead of all of them sharing
+// addresses[0]'s.
+func TestPerHostTLSConfig_PerHostServerName(t *testing.T) {
+	addrs := []string{"a.example.com:443", "b.example.com:443"}
+	tlsC := &tls.Config{ServerName: "a.example.com"}
+
+	for _, addr := range addrs {
+		want := strings.Split(addr, ":")[0]
+		got := perHostTLSConfig(tlsC, addr)
+		if got == nil {
+			t.Fatalf("perHostTLSConfig(%q) returned nil", addr)
+		}
+		if got.ServerName != want {
+			t.Errorf("ServerName for %s = %q, want %q", addr, got.ServerName, want)
+		}
+	}
+
+	if perHostTLSConfig(nil, addrs[0]) != nil {
+		t.Error("perHostTLSConfig(nil, ...) should return nil so the dialer falls back to insecure credentials")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+This file contains Guard, a signal-aware graceful shutdown helper. Without
+it, a Ctrl-C on a long-running job leaves locks pinned until the server
+side timeout expires; Guard releases them immediately instead.
+*/
+
+package client
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownTimeout bounds how long Guard waits for in-flight Unlock
+// calls before giving up and letting the process exit anyway.
+const defaultShutdownTimeout = 10 * time.Second
+
+// Guard installs a signal handler that, on any of signals (SIGINT and
+// SIGTERM if none are given), stops every active refresher and unlocks
+// the lock it keeps alive before the process exits. Locks held without a
+// refresher are not unlocked. It returns a
+// deregister function that cancels the handler without exiting, for
+// tests and library embedders that want to opt out.
+//
+// Guard coordinates with Close: Close also releases locks, and Close is
+// idempotent, so Guard simply calls Close from the signal handler.
+func (c *client) Guard(signals ...os.Signal) func() {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		select {
+		case <-ch:
+			c.Close()
+			os.Exit(0)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// releaseAll stops every active refresher and unlocks its lock,
+// returning once every unlock attempt has completed or timeout elapses,
+// whichever comes first.
+func (c *client) releaseAll(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	var wg sync.WaitGroup
+	c.refreshMap.Range(func(k, v any) bool {
+		name := k.(string)
+		rf := v.(*refresher)
+		rf.Stop()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Unlock(name, rf.key)
+		}()
+		return true
+	})
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imoore76/go-ldlm/clock/fakeclock"
+	pb "github.com/imoore76/go-ldlm/protos"
+)
+
+// fakeGuardTransport is a transport double implementing only what Close
+// and releaseAll need: Unlock and Close. Lock/TryLock/RefreshLock are
+// never exercised by these tests, so they're left to panic via the
+// embedded nil transport if ever called.
+type fakeGuardTransport struct {
+	transport
+
+	unlockCalls atomic.Int32
+	closeCalls  atomic.Int32
+}
+
+func (t *fakeGuardTransport) Unlock(ctx context.Context, req *pb.UnlockRequest) (*pb.UnlockResponse, error) {
+	t.unlockCalls.Add(1)
+	return &pb.UnlockResponse{Unlocked: true}, nil
+}
+
+func (t *fakeGuardTransport) Close() error {
+	t.closeCalls.Add(1)
+	return nil
+}
+
+// slowUnlockTransport is a transport double whose Unlock blocks until
+// unblock is closed, for exercising releaseAll's timeout.
+type slowUnlockTransport struct {
+	fakeGuardTransport
+
+	unblock chan struct{}
+}
+
+func (t *slowUnlockTransport) Unlock(ctx context.Context, req *pb.UnlockRequest) (*pb.UnlockResponse, error) {
+	t.unlockCalls.Add(1)
+	<-t.unblock
+	return &pb.UnlockResponse{Unlocked: true}, nil
+}
+
+// TestReleaseAll_TimesOutOnSlowUnlock verifies that releaseAll does not
+// block past timeout even if an Unlock call never returns.
+func TestReleaseAll_TimesOutOnSlowUnlock(t *testing.T) {
+	tr := &slowUnlockTransport{unblock: make(chan struct{})}
+	defer close(tr.unblock)
+	clk := fakeclock.New()
+	c := &client{transport: tr, ctx: context.Background(), clock: clk}
+
+	valid := &atomic.Bool{}
+	valid.Store(true)
+	r := NewRefresher(c, "foo", "key", 60, RefreshPolicy{}, valid)
+	c.refreshMap.Store("foo", r)
+	defer r.Stop()
+
+	start := time.Now()
+	c.releaseAll(10 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("releaseAll blocked for %v, want it to return around its 10ms timeout", elapsed)
+	}
+	if tr.unlockCalls.Load() == 0 {
+		t.Fatal("releaseAll never attempted to unlock the held lock")
+	}
+}
+
+// TestReleaseAll_StopsRefreshers verifies that releaseAll stops every
+// refresher it iterates, regardless of whether the Unlock call finishes
+// in time.
+func TestReleaseAll_StopsRefreshers(t *testing.T) {
+	tr := &fakeGuardTransport{}
+	c := &client{transport: tr, ctx: context.Background(), clock: fakeclock.New()}
+
+	valid := &atomic.Bool{}
+	valid.Store(true)
+	r := NewRefresher(c, "foo", "key", 60, RefreshPolicy{}, valid)
+	c.refreshMap.Store("foo", r)
+
+	c.releaseAll(time.Second)
+
+	select {
+	case <-r.stop:
+	default:
+		t.Fatal("releaseAll did not stop the refresher")
+	}
+}
+
+// TestClient_CloseIsIdempotent verifies that calling Close more than once
+// only releases locks and closes the transport a single time.
+func TestClient_CloseIsIdempotent(t *testing.T) {
+	tr := &fakeGuardTransport{}
+	c := &client{transport: tr, ctx: context.Background(), clock: fakeclock.New()}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("first Close: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if tr.closeCalls.Load() != 1 {
+		t.Errorf("transport.Close called %d times, want 1", tr.closeCalls.Load())
+	}
+}
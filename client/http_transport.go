@@ -0,0 +1,175 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+This file contains an HTTP/JSON transport, for environments where inbound
+gRPC/HTTP2 isn't practical (proxies, WAFs, browsers via a thin shim). It
+speaks the same request/response schema as the gRPC transport - the pb
+request/response types - just marshaled as JSON over plain HTTP POSTs,
+so error codes still funnel through rpcErrorToError.
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	pb "github.com/imoore76/go-ldlm/protos"
+)
+
+// httpTransport speaks LDLM's RPCs as JSON over HTTP POSTs.
+type httpTransport struct {
+	// httpClients holds one *http.Client per address, each with its own
+	// TLS config so ServerName/SNI matches the host actually being dialed
+	// when do fails over between addresses.
+	httpClients map[string]*http.Client
+	scheme      string
+	bearer      string
+
+	mu        sync.Mutex
+	addresses []string
+	pinned    int
+}
+
+// newHttpTransport returns an httpTransport that posts JSON-encoded
+// requests to addresses, using tlsC (if non-nil) for the underlying
+// connections.
+func newHttpTransport(addresses []string, conf Config, tlsC *tls.Config) (*httpTransport, error) {
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no addresses configured")
+	}
+
+	scheme := "http"
+	httpClients := make(map[string]*http.Client, len(addresses))
+	for _, addr := range addresses {
+		client := &http.Client{}
+		if tlsC != nil {
+			scheme = "https"
+			hostTlsC := tlsC.Clone()
+			hostTlsC.ServerName = strings.Split(addr, ":")[0]
+			client.Transport = &http.Transport{TLSClientConfig: hostTlsC}
+		}
+		httpClients[addr] = client
+	}
+
+	return &httpTransport{
+		httpClients: httpClients,
+		scheme:      scheme,
+		bearer:      conf.Password,
+		addresses:   addresses,
+	}, nil
+}
+
+// do posts req as JSON to path on the pinned address and decodes the
+// response into resp, failing over to the next configured address on a
+// transient error.
+func (t *httpTransport) do(ctx context.Context, path string, req any, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	start := t.pinned
+	n := len(t.addresses)
+	t.mu.Unlock()
+
+	var lastErr error
+	for i := 0; i < n; i++ {
+		t.mu.Lock()
+		addr := t.addresses[(start+i)%n]
+		t.mu.Unlock()
+
+		url := fmt.Sprintf("%s://%s%s", t.scheme, addr, path)
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		if t.bearer != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+t.bearer)
+		}
+
+		httpResp, err := t.httpClients[addr].Do(httpReq)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		err = func() error {
+			defer httpResp.Body.Close()
+			if httpResp.StatusCode >= 500 {
+				return fmt.Errorf("ldlm server at %s returned status %d", addr, httpResp.StatusCode)
+			}
+			return json.NewDecoder(httpResp.Body).Decode(resp)
+		}()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		t.mu.Lock()
+		t.pinned = (start + i) % n
+		t.mu.Unlock()
+		return nil
+	}
+
+	return fmt.Errorf("no reachable ldlm endpoint: %w", lastErr)
+}
+
+func (t *httpTransport) Lock(ctx context.Context, req *pb.LockRequest) (*pb.LockResponse, error) {
+	resp := &pb.LockResponse{}
+	if err := t.do(ctx, "/v1/Lock", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) TryLock(ctx context.Context, req *pb.TryLockRequest) (*pb.LockResponse, error) {
+	resp := &pb.LockResponse{}
+	if err := t.do(ctx, "/v1/TryLock", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) Unlock(ctx context.Context, req *pb.UnlockRequest) (*pb.UnlockResponse, error) {
+	resp := &pb.UnlockResponse{}
+	if err := t.do(ctx, "/v1/Unlock", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) RefreshLock(ctx context.Context, req *pb.RefreshLockRequest) (*pb.LockResponse, error) {
+	resp := &pb.LockResponse{}
+	if err := t.do(ctx, "/v1/RefreshLock", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) Close() error {
+	for _, c := range t.httpClients {
+		c.CloseIdleConnections()
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewHttpTransport_PerHostServerName(t *testing.T) {
+	addrs := []string{"a.example.com:443", "b.example.com:443"}
+	tlsC := &tls.Config{ServerName: "a.example.com"}
+
+	tr, err := newHttpTransport(addrs, Config{}, tlsC)
+	if err != nil {
+		t.Fatalf("newHttpTransport: %v", err)
+	}
+
+	for _, addr := range addrs {
+		want := strings.Split(addr, ":")[0]
+		c, ok := tr.httpClients[addr]
+		if !ok {
+			t.Fatalf("no http.Client for %s", addr)
+		}
+		rt, ok := c.Transport.(*http.Transport)
+		if !ok {
+			t.Fatalf("expected *http.Transport for %s, got %T", addr, c.Transport)
+		}
+		if got := rt.TLSClientConfig.ServerName; got != want {
+			t.Errorf("ServerName for %s = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestHttpTransport_DoFailover(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer up.Close()
+
+	addrs := []string{strings.TrimPrefix(down.URL, "http://"), strings.TrimPrefix(up.URL, "http://")}
+	tr, err := newHttpTransport(addrs, Config{}, nil)
+	if err != nil {
+		t.Fatalf("newHttpTransport: %v", err)
+	}
+
+	var resp struct {
+		Ok bool `json:"ok"`
+	}
+	if err := tr.do(context.Background(), "/v1/Lock", struct{}{}, &resp); err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	if !resp.Ok {
+		t.Error("expected response decoded from the healthy endpoint")
+	}
+	if got := addrs[tr.pinned]; got != addrs[1] {
+		t.Errorf("pinned address = %s, want %s", got, addrs[1])
+	}
+}
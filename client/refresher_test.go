@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imoore76/go-ldlm/clock/fakeclock"
+	pb "github.com/imoore76/go-ldlm/protos"
+)
+
+// fakeRefreshTransport is a transport double that only implements
+// RefreshLock, counting calls and returning canned responses/errors in
+// order - enough to drive the refresher loop without a real server.
+type fakeRefreshTransport struct {
+	transport
+
+	calls int
+	errs  []error
+}
+
+func (t *fakeRefreshTransport) RefreshLock(ctx context.Context, req *pb.RefreshLockRequest) (*pb.LockResponse, error) {
+	var err error
+	if t.calls < len(t.errs) {
+		err = t.errs[t.calls]
+	}
+	t.calls++
+	if err != nil {
+		return nil, err
+	}
+	return &pb.LockResponse{Name: req.Name, Key: req.Key, Locked: true}, nil
+}
+
+func TestRefresher_Interval(t *testing.T) {
+	r := &refresher{lockTimeoutSeconds: 60, policy: RefreshPolicy{}}
+	if got, want := r.interval(), 30*time.Second; got != want {
+		t.Errorf("interval() = %v, want %v", got, want)
+	}
+
+	// lockTimeoutSeconds below the default lead floors to MinIntervalSeconds.
+	r = &refresher{lockTimeoutSeconds: 5, policy: RefreshPolicy{}}
+	if got, want := r.interval(), time.Duration(minRefreshSeconds)*time.Second; got != want {
+		t.Errorf("interval() below lead = %v, want %v", got, want)
+	}
+
+	r = &refresher{lockTimeoutSeconds: 120, policy: RefreshPolicy{LeadSeconds: 20, MinIntervalSeconds: 5}}
+	if got, want := r.interval(), 100*time.Second; got != want {
+		t.Errorf("interval() with policy overrides = %v, want %v", got, want)
+	}
+}
+
+func TestRefresher_NextDelayUsesBackoffAfterError(t *testing.T) {
+	r := &refresher{lockTimeoutSeconds: 60}
+	if got, want := r.nextDelay(), r.interval(); got != want {
+		t.Errorf("nextDelay() with no prior failures = %v, want %v", got, want)
+	}
+
+	// backoffDelay jitters its result, so just assert nextDelay moved off
+	// of the steady-state interval and into backoffDelay's expected
+	// range (refreshBackoffBase*2 +/- 20%) once a failure is recorded.
+	r.backoffAttempt = 1
+	got := r.nextDelay()
+	base := refreshBackoffBase * 2
+	if lo, hi := base*8/10, base*12/10; got < lo || got > hi {
+		t.Errorf("nextDelay() after a failure = %v, want in [%v, %v]", got, lo, hi)
+	}
+}
+
+// TestRefresher_RetriesThenRecovers drives a refresher against a fake
+// clock: the first refresh attempt fails transiently, the second
+// succeeds, and the refresher must back off before the retry instead of
+// waiting a full interval.
+func TestRefresher_RetriesThenRecovers(t *testing.T) {
+	clk := fakeclock.New()
+	tr := &fakeRefreshTransport{errs: []error{context.DeadlineExceeded}}
+	c := &client{transport: tr, ctx: context.Background(), clock: clk}
+
+	valid := &atomic.Bool{}
+	valid.Store(true)
+	r := NewRefresher(c, "foo", "key", 60, RefreshPolicy{}, valid)
+	defer r.Stop()
+
+	clk.Advance(30 * time.Second)
+	waitForCalls(t, tr, 1)
+	if !valid.Load() {
+		t.Fatal("valid was cleared on a transient error")
+	}
+
+	// backoffAttempt is now 1, so the retry delay is refreshBackoffBase*2
+	// +/- 20% jitter; advance well past the widest possible jittered delay.
+	clk.Advance(2 * time.Second)
+	waitForCalls(t, tr, 2)
+}
+
+// TestRefresher_GivesUpOnTerminalError verifies that a terminal refresh
+// error (the lock no longer exists) stops the refresher and flips Valid
+// to false instead of retrying.
+func TestRefresher_GivesUpOnTerminalError(t *testing.T) {
+	clk := fakeclock.New()
+	tr := &fakeRefreshTransport{errs: []error{ErrLockDoesNotExist}}
+	c := &client{transport: tr, ctx: context.Background(), clock: clk}
+
+	var lost string
+	c.onLockLost = func(name string) { lost = name }
+
+	valid := &atomic.Bool{}
+	valid.Store(true)
+	r := NewRefresher(c, "foo", "key", 60, RefreshPolicy{}, valid)
+	c.refreshMap.Store("foo", r) // as maybeCreateRefresher would have done
+	defer r.Stop()
+
+	clk.Advance(30 * time.Second)
+	waitForCalls(t, tr, 1)
+
+	deadline := time.Now().Add(time.Second)
+	for valid.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if valid.Load() {
+		t.Fatal("valid was not cleared after a terminal error")
+	}
+	if lost != "foo" {
+		t.Errorf("onLockLost called with %q, want %q", lost, "foo")
+	}
+	if _, ok := c.refreshMap.Load("foo"); ok {
+		t.Error("refresher was not removed from refreshMap on give up")
+	}
+}
+
+// waitForCalls polls until tr has recorded n calls or fails the test
+// after a short deadline - the refresher's RefreshLock call happens on
+// its own goroutine after the fake clock fires a timer.
+func waitForCalls(t *testing.T, tr *fakeRefreshTransport, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if tr.calls >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("calls = %d after 1s, want >= %d", tr.calls, n)
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+This file defines the transport interface that sits between the client's
+public Lock/TryLock/Unlock/RefreshLock API and the wire. This keeps how a
+request reaches the server (gRPC today, optionally HTTP/JSON) invisible to
+everything above it: LockOptions, refreshers, and TLS/password auth.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	pb "github.com/imoore76/go-ldlm/protos"
+	"google.golang.org/grpc"
+)
+
+// transport supports the service.LDLM RPCs via some wire protocol. A
+// client holds exactly one transport, selected by Config.Transport.
+type transport interface {
+	Lock(ctx context.Context, req *pb.LockRequest) (*pb.LockResponse, error)
+	TryLock(ctx context.Context, req *pb.TryLockRequest) (*pb.LockResponse, error)
+	Unlock(ctx context.Context, req *pb.UnlockRequest) (*pb.UnlockResponse, error)
+	RefreshLock(ctx context.Context, req *pb.RefreshLockRequest) (*pb.LockResponse, error)
+	Close() error
+}
+
+// newTransport builds the transport selected by conf.Transport ("grpc",
+// the default, or "http"), dialing or connecting to every address in
+// addresses.
+//
+// Parameters:
+// - conf: The Config struct containing the client configuration.
+// - addresses: The de-duplicated list of server addresses to use.
+// - dialOpts: Optional grpc.DialOptions, only used by the "grpc" transport.
+// - tlsC: The TLS config to connect with, or nil for plaintext.
+//
+// Returns:
+// - transport: The newly created transport.
+// - error: An error if the transport could not be created.
+func newTransport(conf Config, addresses []string, dialOpts []grpc.DialOption, tlsC *tls.Config) (transport, error) {
+	switch conf.Transport {
+	case "", "grpc":
+		return newGrpcTransport(addresses, dialOpts, conf.MaxRetries, tlsC)
+	case "http":
+		return newHttpTransport(addresses, conf, tlsC)
+	default:
+		return nil, fmt.Errorf("unknown transport %q: must be \"grpc\" or \"http\"", conf.Transport)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package clock provides a small abstraction over time.Now, time.NewTimer,
+and time.Sleep so that code which schedules work - like the client's
+lock refresher - can be driven by a fake clock in tests instead of real
+sleeps. See the fakeclock subpackage for the test implementation.
+*/
+package clock
+
+import "time"
+
+// Timer mirrors the parts of *time.Timer that callers need: a channel
+// that fires when the timer expires, and a way to stop it early.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Clock is the source of time and timers used by code under test.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a Timer that will fire after d.
+	NewTimer(d time.Duration) Timer
+	// Sleep blocks for d.
+	Sleep(d time.Duration)
+}
+
+// New returns a Clock backed by the real time package.
+func New() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r realTimer) C() <-chan time.Time { return r.t.C }
+
+func (r realTimer) Stop() bool { return r.t.Stop() }
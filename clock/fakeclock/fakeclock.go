@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package fakeclock provides a clock.Clock implementation whose time only
+moves when the test tells it to, via Advance. This lets tests of
+time-driven code - like the client's lock refresher, or the timer
+manager - run instantly and deterministically instead of sleeping for
+real wall-clock time.
+*/
+package fakeclock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/imoore76/go-ldlm/clock"
+)
+
+// Clock is a fake clock.Clock whose Now only advances when Advance is
+// called.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*timer
+}
+
+// New returns a Clock starting at the Unix epoch.
+func New() *Clock {
+	return NewAt(time.Unix(0, 0))
+}
+
+// NewAt returns a Clock starting at t.
+func NewAt(t time.Time) *Clock {
+	return &Clock{now: t}
+}
+
+// Now returns the clock's current time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a Timer that fires the next time the clock is
+// Advance()d to or past d from now.
+func (c *Clock) NewTimer(d time.Duration) clock.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &timer{
+		c:        c,
+		ch:       make(chan time.Time, 1),
+		deadline: c.now.Add(d),
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Sleep advances the clock by d. Unlike a real sleep it returns
+// immediately; it exists so code that calls clock.Clock.Sleep works
+// against a fake clock without blocking tests for real.
+func (c *Clock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Advance moves the clock's time forward by d, firing any timer whose
+// deadline is now at or in the past.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	remaining := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.deadline.After(c.now) {
+			select {
+			case t.ch <- c.now:
+			default:
+			}
+		} else {
+			remaining = append(remaining, t)
+		}
+	}
+	c.timers = remaining
+}
+
+// timer is the fake Timer returned by Clock.NewTimer.
+type timer struct {
+	c        *Clock
+	ch       chan time.Time
+	deadline time.Time
+}
+
+func (t *timer) C() <-chan time.Time { return t.ch }
+
+// Stop removes the timer from its clock if it hasn't fired yet. It
+// reports whether the timer was removed before firing, matching
+// time.Timer.Stop's contract.
+func (t *timer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+
+	for i, other := range t.c.timers {
+		if other == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
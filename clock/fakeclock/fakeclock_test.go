@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeclock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/imoore76/go-ldlm/clock/fakeclock"
+)
+
+func TestClock_Advance(t *testing.T) {
+	assert := assert.New(t)
+	c := fakeclock.New()
+	start := c.Now()
+
+	c.Advance(5 * time.Second)
+	assert.Equal(start.Add(5*time.Second), c.Now())
+}
+
+func TestClock_NewTimer(t *testing.T) {
+	assert := assert.New(t)
+	c := fakeclock.New()
+
+	timer := c.NewTimer(10 * time.Second)
+
+	c.Advance(5 * time.Second)
+	select {
+	case <-timer.C():
+		assert.Fail("timer fired early")
+	default:
+	}
+
+	c.Advance(5 * time.Second)
+	select {
+	case <-timer.C():
+	default:
+		assert.Fail("timer did not fire")
+	}
+}
+
+func TestClock_TimerStop(t *testing.T) {
+	assert := assert.New(t)
+	c := fakeclock.New()
+
+	timer := c.NewTimer(1 * time.Second)
+	assert.True(timer.Stop())
+
+	c.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	assert.False(timer.Stop())
+}
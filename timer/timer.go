@@ -0,0 +1,144 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+This file contains the timer manager struct and methods. A timer manager is used for handling a
+map of timers which perform a callback when they expire. They can be removed or renewed before
+they expire. Timers are driven by a clock.Clock instead of the time package directly, so tests
+can substitute a fakeclock.Clock and advance time deterministically instead of sleeping.
+*/
+package timer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/imoore76/go-ldlm/clock"
+)
+
+var ErrTimerDoesNotExist = errors.New("timer does not exist")
+
+// managedTimer is one entry in a Manager's map: the clock.Timer driving
+// it, its callback, and a channel used to stop its goroutine without
+// letting the callback fire.
+type managedTimer struct {
+	timer     clock.Timer
+	onTimeout func()
+	stop      chan struct{}
+}
+
+// Manager manages a map of timers which perform a callback when they expire.
+type Manager struct {
+	clk       clock.Clock
+	timers    map[string]*managedTimer
+	timersMtx sync.Mutex
+}
+
+// NewManager initializes a new Manager backed by the real clock.
+//
+// Returns a pointer to Manager and a closer function.
+func NewManager() (*Manager, func()) {
+	return NewManagerWithClock(clock.New())
+}
+
+// NewManagerWithClock is like NewManager, but lets callers - normally
+// tests - supply the clock.Clock that drives timers, e.g. a
+// fakeclock.Clock.
+//
+// Returns a pointer to Manager and a closer function.
+func NewManagerWithClock(clk clock.Clock) (*Manager, func()) {
+	m := &Manager{
+		clk:    clk,
+		timers: make(map[string]*managedTimer),
+	}
+	return m, m.shutdown
+}
+
+// Add creates and adds a timer to the map. onTimeout fires after timeout
+// elapses, and the timer removes itself from the map once it does.
+func (m *Manager) Add(key string, onTimeout func(), timeout time.Duration) {
+	mt := &managedTimer{
+		timer:     m.clk.NewTimer(timeout),
+		onTimeout: onTimeout,
+		stop:      make(chan struct{}),
+	}
+
+	m.timersMtx.Lock()
+	m.timers[key] = mt
+	m.timersMtx.Unlock()
+
+	go m.run(key, mt)
+}
+
+// run waits for mt to either fire or be stopped (by Remove, Refresh, or
+// shutdown), invoking its callback only in the fire case.
+func (m *Manager) run(key string, mt *managedTimer) {
+	select {
+	case <-mt.timer.C():
+		mt.onTimeout()
+		m.Remove(key)
+	case <-mt.stop:
+	}
+}
+
+// Remove removes and stops a timer, preventing its callback from firing
+// if it hasn't already.
+func (m *Manager) Remove(key string) {
+	m.timersMtx.Lock()
+	mt, ok := m.timers[key]
+	if ok {
+		delete(m.timers, key)
+	}
+	m.timersMtx.Unlock()
+
+	if ok {
+		mt.timer.Stop()
+		close(mt.stop)
+	}
+}
+
+// Refresh resets a timer to fire timeout from now, keeping its existing
+// callback. It returns true if the timer was reset, false if the timer
+// had already fired (or been stopped) before Refresh could stop it. If
+// the timer does not exist, it returns ErrTimerDoesNotExist.
+func (m *Manager) Refresh(key string, timeout time.Duration) (bool, error) {
+	m.timersMtx.Lock()
+	mt, ok := m.timers[key]
+	m.timersMtx.Unlock()
+	if !ok {
+		return false, ErrTimerDoesNotExist
+	}
+
+	if !mt.timer.Stop() {
+		return false, nil
+	}
+	close(mt.stop)
+
+	m.Add(key, mt.onTimeout, timeout)
+	return true, nil
+}
+
+// shutdown stops the timer manager, which stops all timers without
+// firing their callbacks.
+func (m *Manager) shutdown() {
+	m.timersMtx.Lock()
+	defer m.timersMtx.Unlock()
+
+	for _, mt := range m.timers {
+		mt.timer.Stop()
+		close(mt.stop)
+	}
+	m.timers = make(map[string]*managedTimer)
+}
@@ -21,24 +21,33 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/imoore76/go-ldlm/clock/fakeclock"
 	"github.com/imoore76/go-ldlm/timer"
 )
 
 func TestManager(t *testing.T) {
 	assert := assert.New(t)
 	expired := newSafeStringSlice()
-	m, cl := timer.NewManager()
+	clk := fakeclock.New()
+	m, cl := timer.NewManagerWithClock(clk)
 
+	fired := make(chan struct{}, 2)
 	m.Add("foo", func() {
 		expired.Add("foo")
+		fired <- struct{}{}
 	}, 1*time.Millisecond)
 	m.Add("me", func() {
 		expired.Add("me")
+		fired <- struct{}{}
 	}, 10*time.Millisecond)
 	m.Add("baz", func() {
 		expired.Add("baz")
 	}, 1*time.Hour)
-	time.Sleep(100 * time.Millisecond)
+
+	clk.Advance(1 * time.Millisecond)
+	<-fired // foo
+	clk.Advance(9 * time.Millisecond)
+	<-fired // me
 	cl()
 
 	assert.Equal([]string{"foo", "me"}, expired.Get())
@@ -47,7 +56,9 @@ func TestManager(t *testing.T) {
 func TestManager_Refresh(t *testing.T) {
 	assert := assert.New(t)
 	expired := newSafeStringSlice()
-	m, cl := timer.NewManager()
+	clk := fakeclock.New()
+	m, cl := timer.NewManagerWithClock(clk)
+	defer cl()
 
 	m.Add("foo", func() {
 		expired.Add("foo")
@@ -63,17 +74,30 @@ func TestManager_Refresh(t *testing.T) {
 	assert.Nil(err)
 	assert.True(ok)
 
-	time.Sleep(1500 * time.Millisecond)
-	cl()
+	clk.Advance(30 * time.Second)
 
-	// Nothing has expired
+	// Nothing has expired: "me" was refreshed well past its original
+	// 1-second timeout, and "foo" (1 minute) and "baz" (1 hour) aren't due
+	// yet either.
 	assert.Equal([]string{}, expired.Get())
 }
 
+func TestManager_Refresh_NotFound(t *testing.T) {
+	assert := assert.New(t)
+	m, cl := timer.NewManager()
+	defer cl()
+
+	ok, err := m.Refresh("nope", 1*time.Hour)
+	assert.False(ok)
+	assert.ErrorIs(err, timer.ErrTimerDoesNotExist)
+}
+
 func TestManager_Remove(t *testing.T) {
 	assert := assert.New(t)
 	expired := newSafeStringSlice()
-	m, cl := timer.NewManager()
+	clk := fakeclock.New()
+	m, cl := timer.NewManagerWithClock(clk)
+	defer cl()
 
 	m.Add("foo", func() {
 		expired.Add("foo")
@@ -86,10 +110,9 @@ func TestManager_Remove(t *testing.T) {
 	}, 1*time.Hour)
 
 	m.Remove("me")
-	time.Sleep(1500 * time.Millisecond)
-	cl()
+	clk.Advance(90 * time.Second)
 
-	// me:you should have been removed before it expired
+	// me should have been removed before it expired
 	assert.Equal([]string{}, expired.Get())
 
 	m.Remove("not") // should do nothing
@@ -98,7 +121,8 @@ func TestManager_Remove(t *testing.T) {
 func TestManager_Shutdown(t *testing.T) {
 	assert := assert.New(t)
 	expired := newSafeStringSlice()
-	m, cl := timer.NewManager()
+	clk := fakeclock.New()
+	m, cl := timer.NewManagerWithClock(clk)
 	defer cl()
 
 	m.Add("foo", func() {
@@ -112,7 +136,7 @@ func TestManager_Shutdown(t *testing.T) {
 	}, 1*time.Second)
 
 	cl()
-	time.Sleep(1500 * time.Millisecond)
+	clk.Advance(time.Hour)
 
 	// Nothing has expired because timers were stopped
 	assert.Equal([]string{}, expired.Get())